@@ -0,0 +1,18 @@
+package main
+
+// BatchOpKind identifies the kind of a single operation within a Batch.
+type BatchOpKind int
+
+const (
+	BatchGet BatchOpKind = iota
+	BatchPut
+	BatchDelete
+)
+
+// Op is a single operation within a Batch: Get reads Key (Value is
+// ignored), Put writes Key/Value, and Delete removes Key.
+type Op struct {
+	Kind  BatchOpKind
+	Key   []byte
+	Value []byte
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/parquet-go/parquet-go"
+	"gitlab.com/tozd/go/errors"
+)
+
+// exportRow is one (timestamp, engine, metric) measurement, flattened out
+// of plotMeasurements so it can be fed into pandas/DuckDB for further
+// analysis instead of only being rendered as an HTML chart.
+type exportRow struct {
+	Timestamp float64 `parquet:"timestamp" json:"timestamp"`
+	Engine    string  `parquet:"engine" json:"engine"`
+	Metric    string  `parquet:"metric" json:"metric"`
+	Value     float64 `parquet:"value" json:"value"`
+	Writers   int     `parquet:"writers" json:"writers"`
+	Readers   int     `parquet:"readers" json:"readers"`
+	Size      int     `parquet:"size" json:"size"`
+	Vary      bool    `parquet:"vary" json:"vary"`
+	Workload  string  `parquet:"workload" json:"workload"`
+}
+
+// exportRows flattens data into exportRow, one per (timestamp, engine,
+// metric) sample. For multi-value metrics (mean/min/max error bars), only
+// the mean is exported; native histograms are exported as one row per
+// quantile in histogramQuantiles (e.g. "get p99"), the same quantiles
+// Plot's own histogram charts are built from.
+func exportRows(data map[plotConfig][]*plotMeasurements) []exportRow {
+	var rows []exportRow
+	for config, allMeasurements := range data {
+		for _, measurements := range allMeasurements {
+			for name, values := range measurements.Data {
+				for i, v := range values {
+					if i >= len(measurements.Timestamps) {
+						break
+					}
+					rows = append(rows, exportRow{
+						Timestamp: measurements.Timestamps[i].Seconds(),
+						Engine:    measurements.Engine,
+						Metric:    name,
+						Value:     v[0],
+						Writers:   config.Writers,
+						Readers:   config.Readers,
+						Size:      config.Size,
+						Vary:      config.Vary,
+						Workload:  config.Workload,
+					})
+				}
+			}
+			for op, histograms := range measurements.Histograms {
+				for i, histogram := range histograms {
+					if i >= len(measurements.Timestamps) {
+						break
+					}
+					for _, q := range histogramQuantiles {
+						rows = append(rows, exportRow{
+							Timestamp: measurements.Timestamps[i].Seconds(),
+							Engine:    measurements.Engine,
+							Metric:    fmt.Sprintf("%s p%g", op, q*100),
+							Value:     histogram.Quantile(q),
+							Writers:   config.Writers,
+							Readers:   config.Readers,
+							Size:      config.Size,
+							Vary:      config.Vary,
+							Workload:  config.Workload,
+						})
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Engine != rows[j].Engine {
+			return rows[i].Engine < rows[j].Engine
+		}
+		if rows[i].Metric != rows[j].Metric {
+			return rows[i].Metric < rows[j].Metric
+		}
+		return rows[i].Timestamp < rows[j].Timestamp
+	})
+	return rows
+}
+
+// exportCSV dumps the post-processed plotMeasurements to a CSV file so
+// results can be fed into pandas/DuckDB for further analysis, instead of
+// only being rendered as an HTML chart.
+func (p *Plot) exportCSV(data map[plotConfig][]*plotMeasurements) errors.E {
+	f, err := os.Create(p.Output)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"timestamp", "engine", "metric", "value", "writers", "readers", "size", "vary", "workload"}); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, row := range exportRows(data) {
+		record := []string{
+			fmt.Sprintf("%g", row.Timestamp),
+			row.Engine,
+			row.Metric,
+			fmt.Sprintf("%g", row.Value),
+			fmt.Sprintf("%d", row.Writers),
+			fmt.Sprintf("%d", row.Readers),
+			fmt.Sprintf("%d", row.Size),
+			fmt.Sprintf("%t", row.Vary),
+			row.Workload,
+		}
+		if err := w.Write(record); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	w.Flush()
+	return errors.WithStack(w.Error())
+}
+
+// exportParquet dumps the post-processed plotMeasurements to a Parquet
+// file, for the same reason as exportCSV but for tools that prefer a
+// columnar format.
+func (p *Plot) exportParquet(data map[plotConfig][]*plotMeasurements) errors.E {
+	rows := exportRows(data)
+	return errors.WithStack(parquet.WriteFile(p.Output, rows))
+}
+
+// regression is one metric's percentage change relative to its baseline
+// value for a given engine.
+type regression struct {
+	Engine        string
+	Metric        string
+	Baseline      float64
+	Current       float64
+	PercentChange float64
+}
+
+// diffAgainstBaseline loads a previous run's logs from p.Baseline, aligns
+// them by plotConfig and engine, and reports the percentage change in
+// median rate and p99 latency for every engine present in both runs under
+// the same config. It returns a non-nil error, causing a nonzero exit
+// code, when any regression exceeds p.RegressionThreshold, so this can
+// gate CI on performance regressions instead of requiring a human to
+// eyeball HTML charts.
+func (p *Plot) diffAgainstBaseline(data map[plotConfig][]*plotMeasurements) errors.E {
+	baseline, errE := p.processFile(p.Baseline)
+	if errE != nil {
+		return errE
+	}
+
+	var regressions []regression
+	var failed []regression
+
+	for config, allMeasurements := range data {
+		if config != baseline.Config {
+			continue
+		}
+		for _, measurements := range allMeasurements {
+			if measurements.Engine != baseline.Engine {
+				continue
+			}
+
+			for _, op := range []string{"get", "set"} {
+				currentRate := median(firstColumn(measurements.Data[op+" rate"]))
+				baselineRate := median(firstColumn(baseline.Data[op+" rate"]))
+				if baselineRate != 0 {
+					regressions = append(regressions, newRegression(measurements.Engine, op+" rate", baselineRate, currentRate))
+				}
+
+				currentP99 := quantileOf(measurements.Histograms[op], 0.99)
+				baselineP99 := quantileOf(baseline.Histograms[op], 0.99)
+				if baselineP99 != 0 {
+					regressions = append(regressions, newRegression(measurements.Engine, op+" p99 latency", baselineP99, currentP99))
+				}
+			}
+		}
+	}
+
+	for _, r := range regressions {
+		fmt.Printf("%s %s: %.2f -> %.2f (%+.1f%%)\n", r.Engine, r.Metric, r.Baseline, r.Current, r.PercentChange*100)
+		// Rates regress when they drop; latencies regress when they grow.
+		isLatency := len(r.Metric) > 7 && r.Metric[len(r.Metric)-7:] == "latency"
+		if (isLatency && r.PercentChange > p.RegressionThreshold) || (!isLatency && -r.PercentChange > p.RegressionThreshold) {
+			failed = append(failed, r)
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.Errorf("%d metric(s) regressed beyond the %.0f%% threshold", len(failed), p.RegressionThreshold*100)
+	}
+	return nil
+}
+
+func newRegression(engine, metric string, baseline, current float64) regression {
+	return regression{
+		Engine:        engine,
+		Metric:        metric,
+		Baseline:      baseline,
+		Current:       current,
+		PercentChange: (current - baseline) / baseline,
+	}
+}
+
+func firstColumn(values [][]float64) []float64 {
+	result := make([]float64, len(values))
+	for i, v := range values {
+		result[i] = v[0]
+	}
+	return result
+}
+
+func quantileOf(histograms []*NativeHistogram, q float64) float64 {
+	if len(histograms) == 0 {
+		return 0
+	}
+	merged := NewNativeHistogram(histograms[0].Schema, histograms[0].ZeroThreshold)
+	for _, h := range histograms {
+		merged.ZeroCount += h.ZeroCount
+		merged.Positive = mergeBuckets(merged.Positive, h.Positive)
+	}
+	return merged.Quantile(q)
+}
+
+func mergeBuckets(into, from []Bucket) []Bucket {
+	counts := map[int32]uint64{}
+	for _, b := range into {
+		counts[b.Index] += b.Count
+	}
+	for _, b := range from {
+		counts[b.Index] += b.Count
+	}
+	result := make([]Bucket, 0, len(counts))
+	for index, count := range counts {
+		result = append(result, Bucket{Index: index, Count: count})
+	}
+	return result
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,169 @@
+package main
+
+import "math"
+
+// Bucket is one sparse bucket of a NativeHistogram: Index identifies the
+// bucket boundary (base^Index .. base^(Index+1)) and Count is the number of
+// observations that fell into it.
+type Bucket struct {
+	Index int32  `json:"index"`
+	Count uint64 `json:"count"`
+}
+
+// NativeHistogram is a Prometheus-style native (sparse, exponentially
+// bucketed) histogram. Buckets are only allocated for values that are
+// actually observed, so it stays cheap even with a fine-grained schema.
+//
+// Bucket boundaries follow base = 2^(2^-Schema): bucket Index covers
+// [base^Index, base^(Index+1)). Values with an absolute value at or below
+// ZeroThreshold are counted in ZeroCount instead of a bucket, to avoid an
+// unbounded number of buckets around zero.
+type NativeHistogram struct {
+	Schema        int32   `json:"schema"`
+	ZeroThreshold float64 `json:"zeroThreshold"`
+	ZeroCount     uint64  `json:"zeroCount"`
+
+	Positive []Bucket `json:"positive"`
+	Negative []Bucket `json:"negative"`
+}
+
+// NewNativeHistogram returns an empty histogram with the given schema
+// (bucket resolution) and zero threshold.
+func NewNativeHistogram(schema int32, zeroThreshold float64) *NativeHistogram {
+	return &NativeHistogram{
+		Schema:        schema,
+		ZeroThreshold: zeroThreshold,
+	}
+}
+
+func (h *NativeHistogram) bucketIndex(value float64) int32 {
+	return int32(math.Floor(math.Log2(value) * math.Exp2(float64(h.Schema))))
+}
+
+// Add records a single observation, growing the matching sparse bucket.
+func (h *NativeHistogram) Add(value float64) {
+	if math.Abs(value) <= h.ZeroThreshold {
+		h.ZeroCount++
+		return
+	}
+	if value > 0 {
+		h.Positive = addToBucket(h.Positive, h.bucketIndex(value))
+	} else {
+		h.Negative = addToBucket(h.Negative, h.bucketIndex(-value))
+	}
+}
+
+func addToBucket(buckets []Bucket, index int32) []Bucket {
+	for i := range buckets {
+		if buckets[i].Index == index {
+			buckets[i].Count++
+			return buckets
+		}
+	}
+	return append(buckets, Bucket{Index: index, Count: 1})
+}
+
+// Count returns the total number of observations recorded in the histogram.
+func (h *NativeHistogram) Count() uint64 {
+	count := h.ZeroCount
+	for _, b := range h.Positive {
+		count += b.Count
+	}
+	for _, b := range h.Negative {
+		count += b.Count
+	}
+	return count
+}
+
+// boundary returns the upper edge of the bucket at index.
+func (h *NativeHistogram) boundary(index int32) float64 {
+	return math.Pow(2, float64(index+1)/math.Exp2(float64(h.Schema)))
+}
+
+// Quantile estimates the value at quantile q (0-1) by inverting the
+// cumulative positive bucket counts, linearly interpolating within the
+// bucket that contains it. It only considers Positive buckets, which is
+// sufficient for latency histograms (all observations are non-negative).
+func (h *NativeHistogram) Quantile(q float64) float64 {
+	total := h.Count()
+	if total == 0 {
+		return 0
+	}
+
+	sorted := append([]Bucket(nil), h.Positive...)
+	sortBuckets(sorted)
+
+	target := q * float64(total)
+	cumulative := float64(h.ZeroCount)
+	if target <= cumulative {
+		return 0
+	}
+	for _, b := range sorted {
+		cumulative += float64(b.Count)
+		if target <= cumulative {
+			lower := math.Pow(2, float64(b.Index)/math.Exp2(float64(h.Schema)))
+			upper := h.boundary(b.Index)
+			// Interpolate linearly between the bucket's edges based on how
+			// far into this bucket's count the target quantile falls.
+			fraction := 1 - (cumulative-target)/float64(b.Count)
+			return lower + fraction*(upper-lower)
+		}
+	}
+	return h.boundary(sorted[len(sorted)-1].Index)
+}
+
+func sortBuckets(buckets []Bucket) {
+	for i := 1; i < len(buckets); i++ {
+		for j := i; j > 0 && buckets[j-1].Index > buckets[j].Index; j-- {
+			buckets[j-1], buckets[j] = buckets[j], buckets[j-1]
+		}
+	}
+}
+
+// Sub returns a new histogram with the per-bucket counts of other
+// subtracted from h, used to turn two cumulative histograms into the delta
+// observed between them. It assumes h is the later (larger or equal)
+// cumulative histogram; callers must detect counter resets themselves
+// (see DetectReset) before calling Sub.
+func (h *NativeHistogram) Sub(other *NativeHistogram) *NativeHistogram {
+	result := NewNativeHistogram(h.Schema, h.ZeroThreshold)
+	result.ZeroCount = subClamped(h.ZeroCount, other.ZeroCount)
+	result.Positive = subBuckets(h.Positive, other.Positive)
+	result.Negative = subBuckets(h.Negative, other.Negative)
+	return result
+}
+
+// subClamped returns a-b, clamped to zero instead of underflowing when b >
+// a. Per-bucket counts are not guaranteed to be monotonically
+// non-decreasing between two non-reset cumulative samples (e.g. the
+// engine's schema changed mid-run without a full counter reset), so we
+// cannot trust plain uint64 subtraction here.
+func subClamped(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+func subBuckets(curr, prev []Bucket) []Bucket {
+	prevByIndex := make(map[int32]uint64, len(prev))
+	for _, b := range prev {
+		prevByIndex[b.Index] = b.Count
+	}
+	result := make([]Bucket, 0, len(curr))
+	for _, b := range curr {
+		count := subClamped(b.Count, prevByIndex[b.Index])
+		if count > 0 {
+			result = append(result, Bucket{Index: b.Index, Count: count})
+		}
+	}
+	return result
+}
+
+// DetectReset reports whether curr looks like it was reset (e.g., the
+// engine process restarted and started counting from zero again) relative
+// to prev, mirroring how Prometheus handles native histogram counter
+// resets: any decrease in total observed count is treated as a reset.
+func DetectReset(prev, curr *NativeHistogram) bool {
+	return curr.Count() < prev.Count()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNativeHistogramQuantile(t *testing.T) {
+	h := NewNativeHistogram(3, 0)
+	for i := 0; i < 100; i++ {
+		h.Add(1) // all observations fall in the same bucket
+	}
+
+	got := h.Quantile(0.5)
+	if math.Abs(got-1) > 0.2 {
+		t.Fatalf("Quantile(0.5) = %v, want approximately 1", got)
+	}
+
+	if got := h.Count(); got != 100 {
+		t.Fatalf("Count() = %d, want 100", got)
+	}
+}
+
+func TestNativeHistogramQuantileEmpty(t *testing.T) {
+	h := NewNativeHistogram(3, 0)
+	if got := h.Quantile(0.99); got != 0 {
+		t.Fatalf("Quantile(0.99) on empty histogram = %v, want 0", got)
+	}
+}
+
+func TestNativeHistogramSub(t *testing.T) {
+	older := NewNativeHistogram(3, 0)
+	older.Add(1)
+	older.Add(1)
+
+	newer := NewNativeHistogram(3, 0)
+	newer.Add(1)
+	newer.Add(1)
+	newer.Add(1)
+	newer.Add(1)
+
+	delta := newer.Sub(older)
+	if got := delta.Count(); got != 2 {
+		t.Fatalf("Sub delta Count() = %d, want 2", got)
+	}
+}
+
+func TestNativeHistogramSubClampsUnderflow(t *testing.T) {
+	// A single bucket whose count went down without a full counter reset
+	// (e.g. a schema change) must clamp to zero instead of wrapping around
+	// as a near-MaxUint64 value.
+	older := &NativeHistogram{Schema: 3, Positive: []Bucket{{Index: 5, Count: 10}}}
+	newer := &NativeHistogram{Schema: 3, Positive: []Bucket{{Index: 5, Count: 3}}}
+
+	delta := newer.Sub(older)
+	for _, b := range delta.Positive {
+		if b.Count > 1<<32 {
+			t.Fatalf("Sub underflowed: bucket %d has count %d", b.Index, b.Count)
+		}
+	}
+	if got := delta.Count(); got != 0 {
+		t.Fatalf("Sub delta Count() = %d, want 0", got)
+	}
+}
+
+func TestDetectReset(t *testing.T) {
+	prev := NewNativeHistogram(3, 0)
+	prev.Add(1)
+	prev.Add(1)
+
+	grown := NewNativeHistogram(3, 0)
+	grown.Add(1)
+	grown.Add(1)
+	grown.Add(1)
+	if DetectReset(prev, grown) {
+		t.Fatal("DetectReset reported a reset for a histogram that only grew")
+	}
+
+	shrunk := NewNativeHistogram(3, 0)
+	shrunk.Add(1)
+	if !DetectReset(prev, shrunk) {
+		t.Fatal("DetectReset did not report a reset for a histogram whose count dropped")
+	}
+}
@@ -3,16 +3,75 @@ package main
 import (
 	"context"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/codenotary/immudb/embedded/appendable"
 	"github.com/codenotary/immudb/embedded/store"
+	"github.com/rs/zerolog"
 	"gitlab.com/tozd/go/errors"
 )
 
 var _ Engine = (*Immudb)(nil)
 
+// defaultHistogramSchema and defaultHistogramZeroThreshold configure the
+// per-op NativeHistogram below. Schema 3 matches Prometheus' own default
+// native histogram resolution; a zero threshold of 0 is fine because
+// latencies are never exactly zero seconds.
+const (
+	defaultHistogramSchema        int32   = 3
+	defaultHistogramZeroThreshold float64 = 0
+)
+
 type Immudb struct {
-	db *store.ImmuStore
+	db      *store.ImmuStore
+	metrics *MetricsRegistry
+	logger  zerolog.Logger
+
+	histogramsMu sync.Mutex
+	histograms   map[string]*NativeHistogram
+	lastFlush    map[string]time.Time
+}
+
+func (e *Immudb) labels(op string) map[string]string {
+	return map[string]string{"engine": e.Name(), "op": op}
+}
+
+// recordLatency feeds a single op latency observation, in seconds, into
+// the classic Prometheus histogram exposed over /metrics (which follows
+// Prometheus convention and stays in seconds) and, in milliseconds, into a
+// per-op NativeHistogram, flushing the latter as a "histogram <op>" log
+// entry roughly every dataIntervalUnit. Plot's heatmap and quantile charts
+// built from that histogram are both labeled in milliseconds, so the unit
+// has to match there.
+func (e *Immudb) recordLatency(op string, seconds float64) {
+	e.metrics.ObserveLatency("kvbench_op_duration_seconds", e.labels(op), seconds)
+
+	e.histogramsMu.Lock()
+	defer e.histogramsMu.Unlock()
+
+	if e.histograms == nil {
+		e.histograms = map[string]*NativeHistogram{}
+		e.lastFlush = map[string]time.Time{}
+	}
+	histogram, ok := e.histograms[op]
+	if !ok {
+		histogram = NewNativeHistogram(defaultHistogramSchema, defaultHistogramZeroThreshold)
+		e.histograms[op] = histogram
+	}
+	histogram.Add(seconds * 1000)
+
+	if time.Since(e.lastFlush[op]) < dataIntervalUnit {
+		return
+	}
+	e.lastFlush[op] = time.Now()
+	e.logger.Info().
+		Int32("histogramSchema", histogram.Schema).
+		Float64("histogramZeroThreshold", histogram.ZeroThreshold).
+		Uint64("histogramZeroCount", histogram.ZeroCount).
+		Interface("histogramPositive", histogram.Positive).
+		Interface("histogramNegative", histogram.Negative).
+		Msg("histogram " + op)
 }
 
 func (e *Immudb) Close() errors.E {
@@ -24,6 +83,13 @@ func (e *Immudb) Sync() errors.E {
 }
 
 func (e *Immudb) Get(key []byte) (io.ReadSeekCloser, errors.E) {
+	e.metrics.AddGauge("kvbench_in_flight", e.labels("get"), 1)
+	defer e.metrics.AddGauge("kvbench_in_flight", e.labels("get"), -1)
+	start := time.Now()
+	defer func() {
+		e.recordLatency("get", time.Since(start).Seconds())
+	}()
+
 	tx, err := e.db.NewTx(context.Background(), store.DefaultTxOptions().WithMode(store.ReadOnlyTx))
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -37,11 +103,93 @@ func (e *Immudb) Get(key []byte) (io.ReadSeekCloser, errors.E) {
 	if err != nil {
 		return nil, errors.Join(err, tx.Cancel())
 	}
+	e.metrics.IncCounter("kvbench_ops_total", e.labels("get"))
 	return newReadSeekCloser(value, func() error {
 		return errors.WithStack(tx.Cancel())
 	}), nil
 }
 
+// immudbScanIterator adapts a store.KeyReader, opened on its own read-only
+// transaction, to the ScanIterator interface.
+type immudbScanIterator struct {
+	tx     *store.OngoingTx
+	reader store.KeyReader
+	limit  int
+	read   int
+
+	key   []byte
+	value []byte
+}
+
+func (it *immudbScanIterator) Next() (bool, errors.E) {
+	if it.limit > 0 && it.read >= it.limit {
+		return false, nil
+	}
+	key, val, err := it.reader.Read(context.Background())
+	if errors.Is(err, store.ErrNoMoreEntries) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	value, err := val.Resolve()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	it.key = key
+	it.value = value
+	it.read++
+	return true, nil
+}
+
+func (it *immudbScanIterator) Key() []byte {
+	return it.key
+}
+
+func (it *immudbScanIterator) Value() []byte {
+	return it.value
+}
+
+func (it *immudbScanIterator) Close() (errE errors.E) {
+	defer func() {
+		err := it.tx.Cancel()
+		if errors.Is(err, store.ErrAlreadyClosed) {
+			err = nil
+		}
+		errE = errors.Join(errE, err)
+	}()
+	return errors.WithStack(it.reader.Close())
+}
+
+// Scan returns an iterator over the key/value pairs in [start, end), in key
+// order, stopping after limit pairs (0 means unlimited). Range-scan
+// performance is the primary differentiator between LSM- and B-tree-backed
+// stores, so every Engine implements this the same way it implements Get.
+func (e *Immudb) Scan(start, end []byte, limit int) (ScanIterator, errors.E) {
+	began := time.Now()
+	defer func() {
+		e.recordLatency("scan", time.Since(began).Seconds())
+	}()
+
+	tx, err := e.db.NewTx(context.Background(), store.DefaultTxOptions().WithMode(store.ReadOnlyTx))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	reader, err := tx.NewKeyReader(store.KeyReaderSpec{
+		SeekKey:       start,
+		EndKey:        end,
+		InclusiveSeek: true,
+		InclusiveEnd:  false,
+	})
+	if err != nil {
+		return nil, errors.Join(err, tx.Cancel())
+	}
+
+	e.metrics.IncCounter("kvbench_ops_total", e.labels("scan"))
+	return &immudbScanIterator{tx: tx, reader: reader, limit: limit}, nil
+}
+
 func (e *Immudb) Init(app *App) errors.E {
 	// We set the max value to 6 GB so that we can test values larger than 2 GB.
 	maxValueLen := 6 * 1024 * 1024 * 1024
@@ -60,6 +208,8 @@ func (e *Immudb) Init(app *App) errors.E {
 		return errors.WithStack(err)
 	}
 	e.db = db
+	e.metrics = app.Metrics
+	e.logger = app.Logger
 	return nil
 }
 
@@ -67,7 +217,70 @@ func (*Immudb) Name() string {
 	return "Immudb"
 }
 
+// Batch commits ops atomically in a single read-write transaction. Get ops
+// are read back through the transaction (not just checked for existence)
+// so that a read-modify-write batch genuinely depends on the read, letting
+// immudb's optimistic concurrency control detect conflicting concurrent
+// writers the same way it would for a real RMW workload.
+func (e *Immudb) Batch(ops []Op) (errE errors.E) {
+	began := time.Now()
+	defer func() {
+		e.recordLatency("batch", time.Since(began).Seconds())
+	}()
+
+	tx, err := e.db.NewTx(context.Background(), store.DefaultTxOptions().WithMode(store.ReadWriteTx))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		err := tx.Cancel()
+		if errors.Is(err, store.ErrAlreadyClosed) {
+			err = nil
+		}
+		errE = errors.Join(errE, err)
+	}()
+
+	for _, op := range ops {
+		switch op.Kind {
+		case BatchGet:
+			ref, err := tx.Get(context.Background(), op.Key)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if _, err := ref.Resolve(); err != nil {
+				return errors.WithStack(err)
+			}
+		case BatchPut:
+			if err := tx.Set(op.Key, nil, op.Value); err != nil {
+				return errors.WithStack(err)
+			}
+		case BatchDelete:
+			if err := tx.Delete(context.Background(), op.Key); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	_, err = tx.Commit(context.Background())
+	if errors.Is(err, store.ErrTxReadConflict) {
+		e.metrics.IncCounter("kvbench_conflicts_total", e.labels("batch"))
+		return errors.WithStack(err)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	e.metrics.IncCounter("kvbench_ops_total", e.labels("batch"))
+	return nil
+}
+
 func (e *Immudb) Put(key []byte, value []byte) (errE errors.E) {
+	e.metrics.AddGauge("kvbench_in_flight", e.labels("put"), 1)
+	defer e.metrics.AddGauge("kvbench_in_flight", e.labels("put"), -1)
+	start := time.Now()
+	defer func() {
+		e.recordLatency("put", time.Since(start).Seconds())
+	}()
+
 	// We want read-write tx to evaluate such transactions even if we are just writing here.
 	tx, err := e.db.NewTx(context.Background(), store.DefaultTxOptions().WithMode(store.ReadWriteTx))
 	if err != nil {
@@ -87,5 +300,9 @@ func (e *Immudb) Put(key []byte, value []byte) (errE errors.E) {
 	}
 
 	_, err = tx.Commit(context.Background())
-	return errors.WithStack(err)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	e.metrics.IncCounter("kvbench_ops_total", e.labels("put"))
+	return nil
 }
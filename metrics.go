@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// metricsHistogramBuckets are the upper bounds (in seconds) of the classic
+// Prometheus histogram buckets used for the exposed op latency metric.
+// They are deliberately static (unlike the NativeHistogram used for chart
+// rendering in plot.go) because the Prometheus text exposition format only
+// supports classic, pre-declared buckets.
+var metricsHistogramBuckets = []float64{0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+type metricKey struct {
+	name   string
+	labels string
+}
+
+func labelsString(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%q", k, labels[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+type classicHistogram struct {
+	buckets []uint64 // cumulative counts, parallel to metricsHistogramBuckets
+	sum     float64
+	count   uint64
+}
+
+func newClassicHistogram() *classicHistogram {
+	return &classicHistogram{buckets: make([]uint64, len(metricsHistogramBuckets))}
+}
+
+func (h *classicHistogram) observe(value float64) {
+	h.sum += value
+	h.count++
+	for i, upperBound := range metricsHistogramBuckets {
+		if value <= upperBound {
+			h.buckets[i]++
+		}
+	}
+}
+
+// MetricsRegistry is a minimal cross-cutting metrics sink: engines report
+// per-op counters, in-flight gauges, and latency histograms into it, and it
+// exposes them over HTTP in Prometheus text exposition format alongside the
+// existing zerolog JSON output.
+type MetricsRegistry struct {
+	mu         sync.Mutex
+	counters   map[metricKey]uint64
+	gauges     map[metricKey]float64
+	histograms map[metricKey]*classicHistogram
+}
+
+// NewMetricsRegistry returns an empty registry ready to be wired into the
+// Put/Get paths of every Engine and served over HTTP.
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		counters:   map[metricKey]uint64{},
+		gauges:     map[metricKey]float64{},
+		histograms: map[metricKey]*classicHistogram{},
+	}
+}
+
+// IncCounter increments a named counter (e.g., "kvbench_ops_total") with
+// the given labels by one.
+func (r *MetricsRegistry) IncCounter(name string, labels map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := metricKey{name: name, labels: labelsString(labels)}
+	r.counters[key]++
+}
+
+// AddGauge adds delta (which may be negative) to a named gauge (e.g., an
+// in-flight operation count).
+func (r *MetricsRegistry) AddGauge(name string, labels map[string]string, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := metricKey{name: name, labels: labelsString(labels)}
+	r.gauges[key] += delta
+}
+
+// ObserveLatency records a single latency observation, in seconds, into a
+// named histogram.
+func (r *MetricsRegistry) ObserveLatency(name string, labels map[string]string, seconds float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := metricKey{name: name, labels: labelsString(labels)}
+	histogram, ok := r.histograms[key]
+	if !ok {
+		histogram = newClassicHistogram()
+		r.histograms[key] = histogram
+	}
+	histogram.observe(seconds)
+}
+
+func metricLine(name, labels string, value float64) string {
+	if labels == "" {
+		return fmt.Sprintf("%s %g\n", name, value)
+	}
+	return fmt.Sprintf("%s{%s} %g\n", name, labels, value)
+}
+
+// ServeHTTP renders the registry in Prometheus text exposition format.
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	for key, value := range r.counters {
+		fmt.Fprint(w, metricLine(key.name, key.labels, float64(value)))
+	}
+	for key, value := range r.gauges {
+		fmt.Fprint(w, metricLine(key.name, key.labels, value))
+	}
+	for key, histogram := range r.histograms {
+		for i, upperBound := range metricsHistogramBuckets {
+			running := histogram.buckets[i]
+			bucketLabels := key.labels
+			if bucketLabels != "" {
+				bucketLabels += ","
+			}
+			bucketLabels += fmt.Sprintf("le=%q", fmt.Sprintf("%g", upperBound))
+			fmt.Fprint(w, metricLine(key.name+"_bucket", bucketLabels, float64(running)))
+		}
+		infLabels := key.labels
+		if infLabels != "" {
+			infLabels += ","
+		}
+		infLabels += `le="+Inf"`
+		fmt.Fprint(w, metricLine(key.name+"_bucket", infLabels, float64(histogram.count)))
+		fmt.Fprint(w, metricLine(key.name+"_sum", key.labels, histogram.sum))
+		fmt.Fprint(w, metricLine(key.name+"_count", key.labels, float64(histogram.count)))
+	}
+}
+
+// Serve starts an HTTP server exposing /metrics on addr. It blocks until
+// the server stops, so callers run it in its own goroutine, the same way
+// App runs the benchmark loop alongside other long-running work.
+func (r *MetricsRegistry) Serve(addr string) errors.E {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+	return errors.WithStack(http.ListenAndServe(addr, mux))
+}
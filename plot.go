@@ -90,9 +90,15 @@ function (){
 `
 
 type Plot struct {
-	Files  []string `arg:"" required:"" help:"JSON log file(s) to use." name:"file" type:"existingfile"`
-	Output string   `short:"O" default:"results.html" help:"Write rendered plots to this file. Default: ${default}." type:"path" placeholder:"FILE"`
-	Assets string   `default:"https://go-echarts.github.io/go-echarts-assets/assets/" help:"Location of assets. Default: ${default}." placeholder:"URL"`
+	Files      []string `arg:"" optional:"" help:"JSON log file(s) to use." name:"file" type:"existingfile"`
+	Prometheus string   `help:"Query a live Prometheus server instead of JSON log files (e.g., where the benchmark's --metrics-addr was scraped from)." placeholder:"URL"`
+	Output     string   `short:"O" default:"results.html" help:"Write rendered plots to this file. Default: ${default}." type:"path" placeholder:"FILE"`
+	Assets     string   `default:"https://go-echarts.github.io/go-echarts-assets/assets/" help:"Location of assets. Default: ${default}." placeholder:"URL"`
+
+	Format string `enum:"html,csv,parquet" default:"html" help:"Output format. Default: ${default}."`
+
+	Baseline            string  `help:"Previous run's JSON log file to diff the current run against, instead of rendering." type:"existingfile" optional:""`
+	RegressionThreshold float64 `default:"0.05" help:"With --baseline, fail with a nonzero exit code when median rate drops or p99 latency grows by more than this fraction. Default: ${default}."`
 }
 
 type logEntry struct {
@@ -100,11 +106,12 @@ type logEntry struct {
 	Message string `json:"message"`
 	Time    string `json:"time"`
 
-	Engine  string `json:"engine"`
-	Writers int    `json:"writers"`
-	Readers int    `json:"readers"`
-	Size    int    `json:"size"`
-	Vary    bool   `json:"vary"`
+	Engine   string `json:"engine"`
+	Writers  int    `json:"writers"`
+	Readers  int    `json:"readers"`
+	Size     int    `json:"size"`
+	Vary     bool   `json:"vary"`
+	Workload string `json:"workload"`
 
 	Timestamp string `json:"timestamp"`
 
@@ -114,13 +121,31 @@ type logEntry struct {
 
 	Count int     `json:"count"`
 	Rate  float64 `json:"rate"`
+
+	HistogramSchema        int32    `json:"histogramSchema"`
+	HistogramZeroThreshold float64  `json:"histogramZeroThreshold"`
+	HistogramZeroCount     uint64   `json:"histogramZeroCount"`
+	HistogramPositive      []Bucket `json:"histogramPositive"`
+	HistogramNegative      []Bucket `json:"histogramNegative"`
+}
+
+// histogram builds the (cumulative) NativeHistogram carried by this entry.
+func (e *logEntry) histogram() *NativeHistogram {
+	return &NativeHistogram{
+		Schema:        e.HistogramSchema,
+		ZeroThreshold: e.HistogramZeroThreshold,
+		ZeroCount:     e.HistogramZeroCount,
+		Positive:      e.HistogramPositive,
+		Negative:      e.HistogramNegative,
+	}
 }
 
 type plotConfig struct {
-	Writers int
-	Readers int
-	Size    int
-	Vary    bool
+	Writers  int
+	Readers  int
+	Size     int
+	Vary     bool
+	Workload string
 }
 
 type plotMeasurements struct {
@@ -129,7 +154,18 @@ type plotMeasurements struct {
 
 	Timestamps []time.Duration
 
-	Data map[string][][]float64
+	Data       map[string][][]float64
+	Histograms map[string][]*NativeHistogram
+}
+
+// configSubtitle formats the writers/readers/size/vary facets shared by
+// every chart for config, plus the workload preset when one was recorded.
+func configSubtitle(config plotConfig) string {
+	subtitle := fmt.Sprintf("writers=%d readers=%d size=%s vary=%t", config.Writers, config.Readers, datasize.ByteSize(config.Size), config.Vary)
+	if config.Workload != "" {
+		subtitle += fmt.Sprintf(" workload=%s", config.Workload)
+	}
+	return subtitle
 }
 
 func makeLineData(timestamps []time.Duration, data [][]float64) []opts.LineData {
@@ -145,6 +181,10 @@ func makeLineData(timestamps []time.Duration, data [][]float64) []opts.LineData
 }
 
 func (p *Plot) Run(logger zerolog.Logger) errors.E {
+	if len(p.Files) == 0 && p.Prometheus == "" {
+		return errors.New("either JSON log file(s) or --prometheus must be provided")
+	}
+
 	data := map[plotConfig][]*plotMeasurements{}
 
 	for _, path := range p.Files {
@@ -155,7 +195,28 @@ func (p *Plot) Run(logger zerolog.Logger) errors.E {
 		data[measurements.Config] = append(data[measurements.Config], measurements)
 	}
 
-	return p.renderData(data)
+	if p.Prometheus != "" {
+		allMeasurements, errE := p.processPrometheus(p.Prometheus)
+		if errE != nil {
+			return errE
+		}
+		for _, measurements := range allMeasurements {
+			data[measurements.Config] = append(data[measurements.Config], measurements)
+		}
+	}
+
+	if p.Baseline != "" {
+		return p.diffAgainstBaseline(data)
+	}
+
+	switch p.Format {
+	case "csv":
+		return p.exportCSV(data)
+	case "parquet":
+		return p.exportParquet(data)
+	default:
+		return p.renderData(data)
+	}
 }
 
 func (p *Plot) processFile(path string) (*plotMeasurements, errors.E) {
@@ -167,8 +228,10 @@ func (p *Plot) processFile(path string) (*plotMeasurements, errors.E) {
 
 	decoder := json.NewDecoder(f)
 	measurements := &plotMeasurements{
-		Data: make(map[string][][]float64),
+		Data:       make(map[string][][]float64),
+		Histograms: make(map[string][]*NativeHistogram),
 	}
+	lastHistogram := map[string]*NativeHistogram{}
 	var start time.Time
 
 	for {
@@ -206,10 +269,18 @@ func (p *Plot) processFile(path string) (*plotMeasurements, errors.E) {
 			measurements.Config.Readers = entry.Readers
 			measurements.Config.Size = entry.Size
 			measurements.Config.Vary = entry.Vary
+		case "workload":
+			measurements.Config.Workload = entry.Workload
 		case "counter get":
 			measurements.Data["get rate"] = append(measurements.Data["get rate"], []float64{entry.Rate})
 		case "counter set":
 			measurements.Data["set rate"] = append(measurements.Data["set rate"], []float64{entry.Rate})
+		case "counter scan":
+			measurements.Data["scan rate"] = append(measurements.Data["scan rate"], []float64{entry.Rate})
+		case "counter conflicts":
+			measurements.Data["conflicts rate"] = append(measurements.Data["conflicts rate"], []float64{entry.Rate})
+		case "sample scan":
+			measurements.Data["scan"] = append(measurements.Data["scan"], []float64{entry.Mean, entry.Min, entry.Max})
 		case "sample get.ready":
 			measurements.Data["get ready"] = append(measurements.Data["get ready"], []float64{entry.Mean, entry.Min, entry.Max})
 		case "sample get.first":
@@ -218,6 +289,11 @@ func (p *Plot) processFile(path string) (*plotMeasurements, errors.E) {
 			measurements.Data["get total"] = append(measurements.Data["get total"], []float64{entry.Mean, entry.Min, entry.Max})
 		case "sample set":
 			measurements.Data["set"] = append(measurements.Data["set"], []float64{entry.Mean, entry.Min, entry.Max})
+		case "histogram get":
+			measurements.Histograms["get"] = append(measurements.Histograms["get"], accumulateHistogram(lastHistogram, "get", &entry))
+		case "histogram put":
+			// Engines record write latency under the "put" op.
+			measurements.Histograms["set"] = append(measurements.Histograms["set"], accumulateHistogram(lastHistogram, "set", &entry))
 		}
 	}
 
@@ -231,15 +307,36 @@ func (p *Plot) processFile(path string) (*plotMeasurements, errors.E) {
 			length = len(values)
 		}
 	}
+	for _, histograms := range measurements.Histograms {
+		if len(histograms) < length {
+			length = len(histograms)
+		}
+	}
 
 	measurements.Timestamps = measurements.Timestamps[:length]
 	for name, values := range measurements.Data {
 		measurements.Data[name] = values[:length]
 	}
+	for name, histograms := range measurements.Histograms {
+		measurements.Histograms[name] = histograms[:length]
+	}
 
 	return measurements, nil
 }
 
+// accumulateHistogram turns the cumulative histogram carried by entry into
+// the delta observed since the last "histogram <op>" entry, handling
+// counter resets the same way Prometheus does for native histograms.
+func accumulateHistogram(last map[string]*NativeHistogram, op string, entry *logEntry) *NativeHistogram {
+	current := entry.histogram()
+	previous, ok := last[op]
+	last[op] = current
+	if !ok || DetectReset(previous, current) {
+		return current
+	}
+	return current.Sub(previous)
+}
+
 func (p *Plot) renderData(data map[plotConfig][]*plotMeasurements) errors.E {
 	page := components.NewPage()
 	page.SetLayout(components.PageFlexLayout)
@@ -247,13 +344,20 @@ func (p *Plot) renderData(data map[plotConfig][]*plotMeasurements) errors.E {
 	page.AssetsHost = p.Assets
 
 	for config, allMeasurements := range data {
-		for _, name := range []string{"get rate", "set rate", "get ready", "get first", "get total", "set"} {
+		for _, name := range []string{"get rate", "set rate", "scan rate", "conflicts rate", "get ready", "get first", "get total", "set", "scan"} {
 			plot, errE := p.renderPlot(config, name, allMeasurements)
 			if errE != nil {
 				return errE
 			}
 			page.AddCharts(plot)
 		}
+		for _, op := range []string{"get", "set"} {
+			if !anyHistograms(allMeasurements, op) {
+				continue
+			}
+			page.AddCharts(p.renderHistogramHeatmap(config, op, allMeasurements))
+			page.AddCharts(p.renderHistogramQuantiles(config, op, allMeasurements))
+		}
 	}
 
 	f, err := os.Create(p.Output)
@@ -308,7 +412,7 @@ func (p *Plot) renderPlot(config plotConfig, name string, allMeasurements []*plo
 	line.SetGlobalOptions(
 		charts.WithTitleOpts(opts.Title{
 			Title:    name,
-			Subtitle: fmt.Sprintf("writers=%d readers=%d size=%s vary=%t\n%s", config.Writers, config.Readers, datasize.ByteSize(config.Size), config.Vary, better),
+			Subtitle: configSubtitle(config) + "\n" + better,
 		}),
 		charts.WithGridOpts(opts.Grid{
 			Top:   "75",
@@ -348,3 +452,124 @@ func (p *Plot) renderPlot(config plotConfig, name string, allMeasurements []*plo
 	)
 	return line, nil
 }
+
+// anyHistograms reports whether at least one of allMeasurements recorded
+// native histograms for op ("get" or "set").
+func anyHistograms(allMeasurements []*plotMeasurements, op string) bool {
+	for _, measurements := range allMeasurements {
+		if len(measurements.Histograms[op]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// renderHistogramHeatmap renders a heatmap with time on the X axis,
+// log-scale latency bucket on the Y axis, and observation count as color,
+// giving a much more faithful picture of tail latency than a single
+// mean/min/max error bar.
+func (p *Plot) renderHistogramHeatmap(config plotConfig, op string, allMeasurements []*plotMeasurements) components.Charter {
+	heatmap := charts.NewHeatMap()
+
+	var minValue, maxValue float64
+	type cell struct {
+		x, y int
+		v    uint64
+	}
+	var cells []cell
+	var yLabels []string
+	yIndex := map[int32]int{}
+
+	for _, measurements := range allMeasurements {
+		for x, histogram := range measurements.Histograms[op] {
+			for _, b := range histogram.Positive {
+				i, ok := yIndex[b.Index]
+				if !ok {
+					i = len(yLabels)
+					yIndex[b.Index] = i
+					yLabels = append(yLabels, fmt.Sprintf("%.3fms", histogram.boundary(b.Index)))
+				}
+				cells = append(cells, cell{x: x, y: i, v: b.Count})
+				if b.Count > 0 && (maxValue == 0 || float64(b.Count) > maxValue) {
+					maxValue = float64(b.Count)
+				}
+			}
+		}
+	}
+
+	data := make([]opts.HeatMapData, len(cells))
+	for i, c := range cells {
+		data[i] = opts.HeatMapData{Value: [3]interface{}{c.x, c.y, c.v}}
+	}
+
+	heatmap.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{
+			Title:    op + " latency histogram",
+			Subtitle: configSubtitle(config) + "\ncolor is observation count per interval",
+		}),
+		charts.WithXAxisOpts(opts.XAxis{
+			Name:         "interval",
+			NameLocation: "center",
+			Type:         "category",
+			NameGap:      30,
+		}),
+		charts.WithYAxisOpts(opts.YAxis{
+			Name: "latency bucket",
+			Type: "category",
+			Data: yLabels,
+		}),
+		charts.WithVisualMapOpts(opts.VisualMap{
+			Calculable: true,
+			Min:        minValue,
+			Max:        maxValue,
+		}),
+	)
+	heatmap.AddSeries(op+" latency", data)
+	return heatmap
+}
+
+var histogramQuantiles = []float64{0.5, 0.95, 0.99, 0.999}
+
+// renderHistogramQuantiles renders p50/p95/p99/p99.9 lines derived by
+// inverting the cumulative bucket counts of each interval's histogram,
+// overlaying every engine's quantiles on a single chart.
+func (p *Plot) renderHistogramQuantiles(config plotConfig, op string, allMeasurements []*plotMeasurements) components.Charter {
+	line := charts.NewLine()
+	line.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{
+			Title:    op + " latency quantiles",
+			Subtitle: configSubtitle(config) + "\nlower is better",
+		}),
+		charts.WithYAxisOpts(opts.YAxis{
+			Name:         "duration (ms)",
+			NameLocation: "center",
+			Type:         "value",
+			NameGap:      50,
+		}),
+		charts.WithXAxisOpts(opts.XAxis{
+			Name:         fmt.Sprintf("duration (%s)", strings.ReplaceAll(dataIntervalUnit.String(), "1", "")),
+			NameLocation: "center",
+			Type:         "value",
+			NameGap:      30,
+		}),
+		charts.WithLegendOpts(opts.Legend{
+			Show:  true,
+			Left:  "280",
+			Right: "140",
+		}),
+	)
+	for _, measurements := range allMeasurements {
+		for _, q := range histogramQuantiles {
+			values := make([][]float64, len(measurements.Histograms[op]))
+			for i, histogram := range measurements.Histograms[op] {
+				values[i] = []float64{histogram.Quantile(q)}
+			}
+			data := makeLineData(measurements.Timestamps, values)
+			line.AddSeries(fmt.Sprintf("%s p%g", measurements.Engine, q*100), data)
+		}
+	}
+	line.SetSeriesOptions(
+		charts.WithLineChartOpts(opts.LineChart{Smooth: true}),
+	)
+	return line
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// prometheusRangeResponse is the subset of Prometheus' HTTP API
+// "/api/v1/query_range" response we care about. See:
+// https://prometheus.io/docs/prometheus/latest/querying/api/#range-queries
+type prometheusRangeResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		Result []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][2]interface{}  `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// queryRange runs a Prometheus range query over [start, now] at step
+// resolution and returns, per engine label, the value series, plus the
+// timestamp grid shared by every series in the response (a single range
+// query always samples every series on the same grid).
+func queryRange(server, query string, start time.Time, step time.Duration) (map[string][]float64, []time.Duration, errors.E) {
+	values := url.Values{}
+	values.Set("query", query)
+	values.Set("start", strconv.FormatInt(start.Unix(), 10))
+	values.Set("end", strconv.FormatInt(time.Now().Unix(), 10))
+	values.Set("step", step.String())
+
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/query_range?%s", server, values.Encode()))
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	var parsed prometheusRangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if parsed.Status != "success" {
+		return nil, nil, errors.Errorf("prometheus query %q did not succeed: status %q", query, parsed.Status)
+	}
+
+	result := map[string][]float64{}
+	var timestamps []time.Duration
+	for _, series := range parsed.Data.Result {
+		engine := series.Metric["engine"]
+		samples := make([]float64, len(series.Values))
+		for i, pair := range series.Values {
+			valueStr, ok := pair[1].(string)
+			if !ok {
+				return nil, nil, errors.Errorf("unexpected value type in prometheus response for %q", query)
+			}
+			value, err := strconv.ParseFloat(valueStr, 64)
+			if err != nil {
+				return nil, nil, errors.WithStack(err)
+			}
+			samples[i] = value
+		}
+		result[engine] = samples
+
+		if timestamps == nil {
+			timestamps = make([]time.Duration, len(series.Values))
+			for i, pair := range series.Values {
+				when, ok := pair[0].(float64)
+				if !ok {
+					return nil, nil, errors.Errorf("unexpected timestamp type in prometheus response for %q", query)
+				}
+				timestamps[i] = time.Duration(when-float64(start.Unix())) * time.Second
+			}
+		}
+	}
+	return result, timestamps, nil
+}
+
+// processPrometheus builds one plotMeasurements per engine by querying a
+// live Prometheus server for the same kvbench_* metrics that
+// MetricsRegistry exposes over /metrics, instead of reading them back from
+// a JSON log file. This lets Plot be pointed at a Prometheus server that
+// has been scraping a long-running benchmark, without waiting for it to
+// finish and post-process a log.
+func (p *Plot) processPrometheus(server string) ([]*plotMeasurements, errors.E) {
+	start := time.Now().Add(-1 * time.Hour)
+	step := dataIntervalUnit
+
+	getRate, timestamps, errE := queryRange(server, `sum by (engine) (rate(kvbench_ops_total{op="get"}[1m]))`, start, step)
+	if errE != nil {
+		return nil, errE
+	}
+	setRate, _, errE := queryRange(server, `sum by (engine) (rate(kvbench_ops_total{op="put"}[1m]))`, start, step)
+	if errE != nil {
+		return nil, errE
+	}
+
+	byEngine := map[string]*plotMeasurements{}
+	engineMeasurements := func(engine string) *plotMeasurements {
+		measurements, ok := byEngine[engine]
+		if !ok {
+			measurements = &plotMeasurements{
+				Engine:     engine,
+				Timestamps: timestamps,
+				Data:       map[string][][]float64{},
+				Histograms: map[string][]*NativeHistogram{},
+			}
+			byEngine[engine] = measurements
+		}
+		return measurements
+	}
+
+	for engine, samples := range getRate {
+		engineMeasurements(engine).Data["get rate"] = floatsToRows(samples)
+	}
+	for engine, samples := range setRate {
+		engineMeasurements(engine).Data["set rate"] = floatsToRows(samples)
+	}
+
+	result := make([]*plotMeasurements, 0, len(byEngine))
+	for _, measurements := range byEngine {
+		result = append(result, measurements)
+	}
+	return result, nil
+}
+
+func floatsToRows(values []float64) [][]float64 {
+	rows := make([][]float64, len(values))
+	for i, v := range values {
+		rows[i] = []float64{v}
+	}
+	return rows
+}
@@ -0,0 +1,15 @@
+package main
+
+import "gitlab.com/tozd/go/errors"
+
+// ScanIterator iterates over the key/value pairs returned by Engine.Scan, in
+// key order, from start (inclusive) to end (exclusive). Callers must call
+// Close once done, whether or not iteration ran to completion.
+type ScanIterator interface {
+	// Next advances the iterator and reports whether a pair is available.
+	// Once it returns false, Key and Value are no longer valid.
+	Next() (bool, errors.E)
+	Key() []byte
+	Value() []byte
+	Close() errors.E
+}
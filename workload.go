@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// WorkloadPreset identifies one of the YCSB-style canned workload mixes, or
+// a custom mix configured through Workload's other fields.
+type WorkloadPreset string
+
+const (
+	WorkloadA      WorkloadPreset = "a" // update heavy: 50% reads, 50% updates, Zipfian.
+	WorkloadB      WorkloadPreset = "b" // read mostly: 95% reads, 5% updates, Zipfian.
+	WorkloadC      WorkloadPreset = "c" // read only: 100% reads, Zipfian.
+	WorkloadD      WorkloadPreset = "d" // read latest: 95% reads, 5% inserts, latest distribution.
+	WorkloadE      WorkloadPreset = "e" // short ranges: 95% scans, 5% inserts, Zipfian.
+	WorkloadF      WorkloadPreset = "f" // read-modify-write: 50% reads, 50% RMWs, Zipfian.
+	WorkloadCustom WorkloadPreset = "custom"
+)
+
+// Workload configures a mixed read/write/scan/read-modify-write generator
+// modeled on YCSB's canned workloads A-F: key distribution (uniform,
+// Zipfian, or latest-item), a hot-set fraction, and optional inter-request
+// think-time so that requests arrive as a Poisson process at a target rate
+// instead of as fast as the engine can accept them.
+type Workload struct {
+	Preset WorkloadPreset `enum:"a,b,c,d,e,f,custom" default:"c" help:"Workload preset (YCSB A-F, or custom). Default: ${default}."`
+
+	ReadFraction   float64 `help:"Fraction of requests that are reads, when Preset is custom."`
+	UpdateFraction float64 `help:"Fraction of requests that are updates, when Preset is custom."`
+	ScanFraction   float64 `help:"Fraction of requests that are scans, when Preset is custom."`
+	RMWFraction    float64 `help:"Fraction of requests that are read-modify-writes, when Preset is custom."`
+
+	Distribution   string  `enum:"uniform,zipfian,latest" default:"zipfian" help:"Key distribution. Default: ${default}."`
+	ZipfianTheta   float64 `default:"0.99" help:"Zipfian skew parameter (higher is more skewed). Default: ${default}."`
+	HotSetFraction float64 `default:"0.2" help:"Fraction of the key space treated as hot. Default: ${default}."`
+	HotOpFraction  float64 `default:"0.8" help:"Fraction of operations directed at the hot set. Default: ${default}."`
+
+	TargetRate float64 `help:"Target request rate in ops/s, Poisson-distributed. 0 means no think-time (open-loop)."`
+
+	BatchSize int `default:"1" help:"Number of keys grouped into one transaction for OpRMW batches. Default: ${default}."`
+}
+
+// effectiveDistribution returns the key distribution this workload
+// actually uses. Preset D hardcodes "latest" per its YCSB definition,
+// overriding --workload-distribution; every other preset, and custom,
+// honor it directly.
+func (w *Workload) effectiveDistribution() string {
+	if w.Preset == WorkloadD {
+		return "latest"
+	}
+	return w.Distribution
+}
+
+// ratios returns the (read, update, scan, rmw) ratios for the configured
+// preset, falling back to the *Fraction fields for WorkloadCustom.
+func (w *Workload) ratios() (read, update, scan, rmw float64) {
+	switch w.Preset {
+	case WorkloadA:
+		return 0.5, 0.5, 0, 0
+	case WorkloadB:
+		return 0.95, 0.05, 0, 0
+	case WorkloadC:
+		return 1, 0, 0, 0
+	case WorkloadD:
+		// The 5% "update" in YCSB-D is really an insert of a new latest key;
+		// the distinction is made by the driver, not by this ratio.
+		return 0.95, 0.05, 0, 0
+	case WorkloadE:
+		return 0, 0.05, 0.95, 0
+	case WorkloadF:
+		return 0.5, 0, 0, 0.5
+	default:
+		return w.ReadFraction, w.UpdateFraction, w.ScanFraction, w.RMWFraction
+	}
+}
+
+// OpKind identifies the kind of operation a Workload generator produced.
+type OpKind int
+
+const (
+	OpRead OpKind = iota
+	OpUpdate
+	OpScan
+	OpRMW
+)
+
+func (k OpKind) String() string {
+	switch k {
+	case OpRead:
+		return "read"
+	case OpUpdate:
+		return "update"
+	case OpScan:
+		return "scan"
+	case OpRMW:
+		return "rmw"
+	default:
+		return "unknown"
+	}
+}
+
+// nextKind picks the next operation kind according to the configured
+// ratios.
+func (w *Workload) nextKind(r *rand.Rand) OpKind {
+	read, update, scan, _ := w.ratios()
+	roll := r.Float64()
+	switch {
+	case roll < read:
+		return OpRead
+	case roll < read+update:
+		return OpUpdate
+	case roll < read+update+scan:
+		return OpScan
+	default:
+		return OpRMW
+	}
+}
+
+// ThinkTime returns how long to wait before issuing the next request, so
+// that requests arrive as a Poisson process at TargetRate ops/s. A
+// TargetRate of 0 means no think-time: the driver runs open-loop, issuing
+// requests as fast as every engine can accept them.
+func (w *Workload) ThinkTime(r *rand.Rand) time.Duration {
+	if w.TargetRate <= 0 {
+		return 0
+	}
+	// Inter-arrival times of a Poisson process are exponentially
+	// distributed with rate TargetRate.
+	return time.Duration(r.ExpFloat64() / w.TargetRate * float64(time.Second))
+}
+
+// KeyGenerator draws keys, as integer indices into [0, numKeys), from the
+// distribution configured on a Workload.
+type KeyGenerator struct {
+	workload     *Workload
+	distribution string
+	numKeys      int
+	zipf         *rand.Zipf
+	rand         *rand.Rand
+}
+
+// NewKeyGenerator returns a generator of key indices into [0, numKeys)
+// following w's effective distribution (see Workload.effectiveDistribution)
+// and hot-set fraction.
+func NewKeyGenerator(w *Workload, numKeys int, r *rand.Rand) *KeyGenerator {
+	distribution := w.effectiveDistribution()
+	g := &KeyGenerator{workload: w, distribution: distribution, numKeys: numKeys, rand: r}
+	if (distribution == "zipfian" || distribution == "latest") && numKeys > 1 {
+		// rand.Zipf requires s > 1, so we shift ZipfianTheta away from 1
+		// instead of rejecting configurations at the edge of the range.
+		g.zipf = rand.NewZipf(r, 1+w.ZipfianTheta, 1, uint64(numKeys-1))
+	}
+	return g
+}
+
+// Next returns the next key index. With probability HotOpFraction the key
+// is drawn from the hot HotSetFraction of the key space (using the
+// configured distribution); otherwise it is drawn uniformly from the rest.
+func (g *KeyGenerator) Next() int {
+	w := g.workload
+	hotKeys := int(float64(g.numKeys) * w.HotSetFraction)
+	if hotKeys > 0 && g.rand.Float64() < w.HotOpFraction {
+		switch g.distribution {
+		case "zipfian":
+			return int(g.zipf.Uint64()) % hotKeys
+		case "latest":
+			// The latest distribution favors the most recently inserted
+			// keys, i.e., the tail of the key space, with Zipfian skew.
+			return g.numKeys - 1 - int(g.zipf.Uint64())%hotKeys
+		default:
+			return g.rand.Intn(hotKeys)
+		}
+	}
+	remaining := g.numKeys - hotKeys
+	if remaining <= 0 {
+		// The whole key space is hot, so there is no cold key to draw.
+		return g.rand.Intn(g.numKeys)
+	}
+	if g.distribution == "latest" {
+		// Cold keys under "latest" are the oldest ones: [0, numKeys-hotKeys),
+		// the complement of the hot tail handled above.
+		return g.rand.Intn(remaining)
+	}
+	// Cold keys under "zipfian"/"uniform" are the non-hot tail: [hotKeys, numKeys).
+	return hotKeys + g.rand.Intn(remaining)
+}
+
+// WorkloadOp is a single generated workload request: an operation kind
+// together with the key it applies to.
+type WorkloadOp struct {
+	Kind OpKind
+	Key  int
+}
+
+// NextBatch generates the Batch ops for an OpRMW request: BatchSize keys,
+// each read then written back with a freshly generated value, so that the
+// transaction genuinely depends on its own reads the way a real
+// read-modify-write workload would. keyBytes turns a key index into the
+// engine key, newValue generates the value to write back.
+func (d *WorkloadDriver) NextBatch(keyBytes func(key int) []byte, newValue func() []byte) []Op {
+	ops := make([]Op, 0, d.workload.BatchSize*2)
+	for i := 0; i < d.workload.BatchSize; i++ {
+		key := keyBytes(d.keys.Next())
+		ops = append(ops, Op{Kind: BatchGet, Key: key})
+		ops = append(ops, Op{Kind: BatchPut, Key: key, Value: newValue()})
+	}
+	return ops
+}
+
+// WorkloadDriver generates a stream of WorkloadOp from a Workload
+// configuration and feeds it into a shared queue, so that every Engine
+// under comparison is driven through exactly the same request sequence.
+type WorkloadDriver struct {
+	workload *Workload
+	keys     *KeyGenerator
+	rand     *rand.Rand
+}
+
+// NewWorkloadDriver returns a driver generating numKeys-sized keyspace
+// requests according to w, seeded with seed so that runs are reproducible.
+func NewWorkloadDriver(w *Workload, numKeys int, seed int64) *WorkloadDriver {
+	r := rand.New(rand.NewSource(seed))
+	return &WorkloadDriver{
+		workload: w,
+		keys:     NewKeyGenerator(w, numKeys, r),
+		rand:     r,
+	}
+}
+
+// Run feeds generated operations into queue until ctx is done, respecting
+// the configured think-time between requests.
+func (d *WorkloadDriver) Run(ctx context.Context, queue chan<- WorkloadOp) errors.E {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		op := WorkloadOp{Kind: d.workload.nextKind(d.rand), Key: d.keys.Next()}
+		select {
+		case queue <- op:
+		case <-ctx.Done():
+			return nil
+		}
+
+		if think := d.workload.ThinkTime(d.rand); think > 0 {
+			select {
+			case <-time.After(think):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestKeyGeneratorLatestSelectsOldestKeys(t *testing.T) {
+	w := &Workload{
+		Distribution:   "latest",
+		ZipfianTheta:   0.99,
+		HotSetFraction: 0.2,
+		HotOpFraction:  0.8,
+	}
+	const numKeys = 100
+	r := rand.New(rand.NewSource(1))
+	g := NewKeyGenerator(w, numKeys, r)
+
+	seen := make([]bool, numKeys)
+	for i := 0; i < 20000; i++ {
+		key := g.Next()
+		if key < 0 || key >= numKeys {
+			t.Fatalf("Next() = %d, out of range [0, %d)", key, numKeys)
+		}
+		seen[key] = true
+	}
+
+	hotKeys := int(float64(numKeys) * w.HotSetFraction)
+	for key := 0; key < hotKeys; key++ {
+		if !seen[key] {
+			t.Fatalf("cold key %d (in the oldest %d keys) was never selected under the latest distribution", key, hotKeys)
+		}
+	}
+}
+
+func TestKeyGeneratorZipfianColdRangeExcludesHotSet(t *testing.T) {
+	w := &Workload{
+		Distribution:   "zipfian",
+		ZipfianTheta:   0.99,
+		HotSetFraction: 0.2,
+		HotOpFraction:  0, // always take the cold path
+	}
+	const numKeys = 100
+	hotKeys := int(float64(numKeys) * w.HotSetFraction)
+	r := rand.New(rand.NewSource(1))
+	g := NewKeyGenerator(w, numKeys, r)
+
+	for i := 0; i < 1000; i++ {
+		key := g.Next()
+		if key < hotKeys || key >= numKeys {
+			t.Fatalf("Next() = %d, want a cold key in [%d, %d)", key, hotKeys, numKeys)
+		}
+	}
+}
+
+func TestWorkloadEffectiveDistribution(t *testing.T) {
+	cases := []struct {
+		preset WorkloadPreset
+		flag   string
+		want   string
+	}{
+		{WorkloadD, "zipfian", "latest"},
+		{WorkloadD, "uniform", "latest"},
+		{WorkloadC, "zipfian", "zipfian"},
+		{WorkloadCustom, "uniform", "uniform"},
+	}
+	for _, c := range cases {
+		w := &Workload{Preset: c.preset, Distribution: c.flag}
+		if got := w.effectiveDistribution(); got != c.want {
+			t.Errorf("preset %q with --workload-distribution=%q: effectiveDistribution() = %q, want %q", c.preset, c.flag, got, c.want)
+		}
+	}
+}
+
+func TestWorkloadRatiosSumToOne(t *testing.T) {
+	for _, preset := range []WorkloadPreset{WorkloadA, WorkloadB, WorkloadC, WorkloadD, WorkloadE, WorkloadF} {
+		w := &Workload{Preset: preset}
+		read, update, scan, rmw := w.ratios()
+		sum := read + update + scan + rmw
+		if sum < 0.999 || sum > 1.001 {
+			t.Errorf("preset %q ratios sum to %v, want 1", preset, sum)
+		}
+	}
+}